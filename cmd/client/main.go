@@ -2,20 +2,29 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	mrand "math/rand"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/identw/access-checker/pkg/protocol"
+	"github.com/identw/access-checker/pkg/transfer"
 	"gopkg.in/yaml.v3"
 )
 
@@ -31,6 +40,12 @@ type Test struct {
 	Operation string `yaml:"operation"`
 	Repeat    int    `yaml:"repeat"`
 	Size      string `yaml:"size"`
+	// Seed, if set, makes an upload test's payload deterministic: the same
+	// seed always produces the same bytes (and therefore the same SHA-256),
+	// which lets operators pre-compute expected hashes and diff failing
+	// payloads byte-for-byte across hosts. It is for diagnostics only —
+	// leave it unset to get cryptographically random payloads.
+	Seed *int64 `yaml:"seed,omitempty"`
 }
 
 // TestResult holds the results of a test execution
@@ -49,8 +64,38 @@ func main() {
 	host := flag.String("host", "", "Server address (host:port)")
 	operation := flag.String("op", "", "Operation: 'download' or 'upload'")
 	size := flag.String("size", "", "Data size (e.g., 1KB, 512KB, 1MB, 16MB)")
+	chunkSizeFlag := flag.String("chunk-size", "64KB", "Chunk size used for streaming transfers (e.g., 64KB, 1MB)")
+	timeout := flag.Duration("timeout", 0, "Per-attempt timeout (e.g., 30s, 2m); 0 disables it")
+	seedFlag := flag.String("seed", "", "Optional deterministic seed for upload payloads (diagnostics only)")
+	parallel := flag.Int("parallel", 1, "Number of (test, host) pairs to run concurrently")
+	output := flag.String("output", "", "Machine-readable output mode: json or csv, one record per attempt (written to stdout; human logs stay on stderr)")
 	flag.Parse()
 
+	if *parallel < 1 {
+		log.Fatalf("--parallel must be at least 1")
+	}
+
+	if *output != "" && *output != "json" && *output != "csv" {
+		log.Fatalf("Invalid --output %q: must be 'json' or 'csv'", *output)
+	}
+
+	chunkSize, err := parseSize(*chunkSizeFlag)
+	if err != nil {
+		log.Fatalf("Invalid chunk size '%s': %v", *chunkSizeFlag, err)
+	}
+	if chunkSize == 0 {
+		log.Fatalf("Chunk size must be greater than zero")
+	}
+
+	var seed *int64
+	if *seedFlag != "" {
+		parsed, err := strconv.ParseInt(*seedFlag, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid seed '%s': %v", *seedFlag, err)
+		}
+		seed = &parsed
+	}
+
 	var tests []Test
 	var hosts []string
 	
@@ -82,6 +127,7 @@ func main() {
 			Operation: *operation,
 			Repeat:    1,
 			Size:      *size,
+			Seed:      seed,
 		}
 		tests = append(tests, flagTest)
 		
@@ -108,28 +154,79 @@ func main() {
 	log.Printf("Tests: %d\n", len(tests))
 	log.Printf("=========================================\n\n")
 	
-	var allResults []TestResult
-	
+	var jobs []testJob
 	for _, test := range tests {
 		if err := validateTest(&test); err != nil {
 			log.Printf("⚠ Skipping invalid test '%s': %v\n", test.Name, err)
 			continue
 		}
-		
+
 		for _, host := range hosts {
-			results := executeTest(test, host)
-			allResults = append(allResults, results...)
+			jobs = append(jobs, testJob{test: test, host: host})
 		}
 	}
-	
+
+	allResults := runJobs(jobs, *parallel, chunkSize, *timeout)
+
+	if *output != "" {
+		if err := writeResults(os.Stdout, *output, allResults); err != nil {
+			log.Fatalf("Failed to write %s output: %v", *output, err)
+		}
+	}
+
 	// Print summary
 	printSummary(allResults)
 }
 
+// testJob pairs a test with the single host it should run against; it is
+// the unit of work handed to the worker pool in runJobs.
+type testJob struct {
+	test Test
+	host string
+}
+
+// runJobs executes jobs across a bounded pool of parallel workers,
+// collecting every TestResult over a channel rather than running hosts and
+// tests in sequential nested loops. The combined results are returned in
+// completion order, ready for printSummary (and optionally writeResults).
+func runJobs(jobs []testJob, parallel int, chunkSize uint32, timeout time.Duration) []TestResult {
+	jobCh := make(chan testJob)
+	resultCh := make(chan []TestResult)
+
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobCh {
+				resultCh <- executeTest(j.test, j.host, chunkSize, timeout)
+			}
+		}()
+	}
+
+	go func() {
+		for _, j := range jobs {
+			jobCh <- j
+		}
+		close(jobCh)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	var allResults []TestResult
+	for results := range resultCh {
+		allResults = append(allResults, results...)
+	}
+	return allResults
+}
+
 // executeTest runs a single test on a specific host
-func executeTest(test Test, host string) []TestResult {
+func executeTest(test Test, host string, chunkSize uint32, timeout time.Duration) []TestResult {
 	log.Printf("\n--- Test: %s on %s ---\n", test.Name, host)
-	
+
 	dataSize, err := parseSize(test.Size)
 	if err != nil {
 		log.Printf("✗ Invalid size format '%s': %v\n", test.Size, err)
@@ -140,12 +237,12 @@ func executeTest(test Test, host string) []TestResult {
 			Error:    err,
 		}}
 	}
-	
+
 	var results []TestResult
-	
+
 	for i := 1; i <= test.Repeat; i++ {
 		log.Printf("Attempt %d/%d...\n", i, test.Repeat)
-		
+
 		conn, err := net.Dial("tcp", host)
 		if err != nil {
 			log.Printf("✗ Failed to connect: %v\n", err)
@@ -158,19 +255,48 @@ func executeTest(test Test, host string) []TestResult {
 			})
 			continue
 		}
-		
+
+		ctx := context.Background()
+		var cancel context.CancelFunc
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+
+		// Unblock any in-flight read/write as soon as the context is done,
+		// since net.Conn has no native context support.
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-done:
+			}
+		}()
+
+		progress := attemptProgressLogger(test.Name, host, i)
+
 		var testErr error
 		var duration time.Duration
-		
+
 		switch test.Operation {
 		case "download":
-			duration, testErr = performDownload(conn, dataSize)
+			duration, testErr = performDownload(ctx, conn, dataSize, chunkSize, progress)
 		case "upload":
-			duration, testErr = performUpload(conn, dataSize)
+			duration, testErr = performUpload(ctx, conn, dataSize, chunkSize, test.Seed, progress)
 		default:
 			testErr = fmt.Errorf("unknown operation: %s", test.Operation)
 		}
-		
+
+		if testErr == nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				testErr = fmt.Errorf("attempt timed out: %w", ctxErr)
+			}
+		}
+
+		close(done)
+		if cancel != nil {
+			cancel()
+		}
 		conn.Close()
 		
 		result := TestResult{
@@ -201,6 +327,30 @@ func executeTest(test Test, host string) []TestResult {
 	return results
 }
 
+// attemptProgressLogger returns a transfer.ProgressFunc that prints a
+// live MB/s figure for one test attempt, throttled so it doesn't flood
+// the log with one line per chunk.
+func attemptProgressLogger(testName, host string, attempt int) transfer.ProgressFunc {
+	start := time.Now()
+	var lastLog time.Time
+
+	return func(bytesDone, bytesTotal int64) {
+		now := time.Now()
+		done := bytesDone == bytesTotal
+		if !done && now.Sub(lastLog) < 500*time.Millisecond {
+			return
+		}
+		lastLog = now
+
+		elapsed := now.Sub(start).Seconds()
+		if elapsed == 0 {
+			return
+		}
+		mbps := float64(bytesDone) / elapsed / 1024 / 1024
+		log.Printf("  [%s %s attempt %d] %d/%d bytes (%.2f MB/s)\n", testName, host, attempt, bytesDone, bytesTotal, mbps)
+	}
+}
+
 // validateTest checks if test configuration is valid
 func validateTest(test *Test) error {
 	if test.Name == "" {
@@ -257,47 +407,223 @@ func contains(slice []string, val string) bool {
 	return false
 }
 
-// printSummary displays test results summary
+// testGroupKey identifies the (test, host) group results are bucketed into
+// for percentile reporting.
+type testGroupKey struct {
+	testName string
+	host     string
+}
+
+// testGroupStats accumulates per-attempt latency and throughput samples
+// for one (test, host) group.
+type testGroupStats struct {
+	key         testGroupKey
+	success     int
+	fail        int
+	durations   []time.Duration
+	throughputs []float64 // MB/s, one per successful attempt
+}
+
+// printSummary displays test results grouped by (test, host) with
+// min/median/p95/p99/max latency and throughput, plus a global summary.
+// A single overall average hides tail behavior, which is exactly what an
+// access/throughput checker exists to find.
 func printSummary(results []TestResult) {
 	log.Printf("\n\n========== Test Summary ==========\n")
-	
+
 	totalTests := len(results)
 	successCount := 0
 	failCount := 0
 	var totalDuration time.Duration
-	var totalBytes uint32
-	
+	var totalBytes uint64
+
+	groups := make(map[testGroupKey]*testGroupStats)
+	var groupOrder []testGroupKey
+
 	for _, result := range results {
 		if result.Success {
 			successCount++
 			totalDuration += result.Duration
-			totalBytes += result.BytesSent
+			totalBytes += uint64(result.BytesSent)
 		} else {
 			failCount++
 		}
+
+		key := testGroupKey{testName: result.TestName, host: result.Host}
+		group, ok := groups[key]
+		if !ok {
+			group = &testGroupStats{key: key}
+			groups[key] = group
+			groupOrder = append(groupOrder, key)
+		}
+
+		if result.Success {
+			group.success++
+			group.durations = append(group.durations, result.Duration)
+			if result.Duration > 0 {
+				group.throughputs = append(group.throughputs, float64(result.BytesSent)/result.Duration.Seconds()/1024/1024)
+			}
+		} else {
+			group.fail++
+		}
 	}
-	
+
 	log.Printf("Total tests: %d\n", totalTests)
 	log.Printf("Successful: %d (%.1f%%)\n", successCount, float64(successCount)/float64(totalTests)*100)
 	log.Printf("Failed: %d (%.1f%%)\n", failCount, float64(failCount)/float64(totalTests)*100)
-	
+
+	log.Printf("\n--- Per test/host breakdown ---\n")
+	for _, key := range groupOrder {
+		group := groups[key]
+		log.Printf("%s @ %s: %d/%d succeeded\n", key.testName, key.host, group.success, group.success+group.fail)
+
+		if len(group.durations) == 0 {
+			continue
+		}
+
+		sortedDurations := append([]time.Duration(nil), group.durations...)
+		sort.Slice(sortedDurations, func(i, j int) bool { return sortedDurations[i] < sortedDurations[j] })
+
+		sortedThroughputs := append([]float64(nil), group.throughputs...)
+		sort.Float64s(sortedThroughputs)
+
+		log.Printf("  latency:    min=%v p50=%v p95=%v p99=%v max=%v\n",
+			sortedDurations[0],
+			percentileDuration(sortedDurations, 50),
+			percentileDuration(sortedDurations, 95),
+			percentileDuration(sortedDurations, 99),
+			sortedDurations[len(sortedDurations)-1])
+		log.Printf("  throughput: min=%.2f p50=%.2f p95=%.2f p99=%.2f max=%.2f MB/s\n",
+			sortedThroughputs[0],
+			percentileFloat(sortedThroughputs, 50),
+			percentileFloat(sortedThroughputs, 95),
+			percentileFloat(sortedThroughputs, 99),
+			sortedThroughputs[len(sortedThroughputs)-1])
+	}
+
 	if successCount > 0 {
 		avgDuration := totalDuration / time.Duration(successCount)
 		avgThroughput := float64(totalBytes) / totalDuration.Seconds() / 1024 / 1024
-		log.Printf("Average duration: %v\n", avgDuration)
-		log.Printf("Average throughput: %.2f MB/s\n", avgThroughput)
+		log.Printf("\nGlobal average duration: %v\n", avgDuration)
+		log.Printf("Global average throughput: %.2f MB/s\n", avgThroughput)
 		log.Printf("Total data transferred: %.2f MB\n", float64(totalBytes)/1024/1024)
 	}
-	
+
 	log.Printf("==================================\n")
 }
 
-// performDownload requests data from server and validates hash
-func performDownload(conn net.Conn, size uint32) (time.Duration, error) {
+// percentileDuration returns the p-th percentile (0-100) of an
+// ascending-sorted duration slice, using the nearest-rank method.
+func percentileDuration(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[percentileIndex(len(sorted), p)]
+}
+
+// percentileFloat returns the p-th percentile (0-100) of an
+// ascending-sorted float64 slice, using the nearest-rank method.
+func percentileFloat(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[percentileIndex(len(sorted), p)]
+}
+
+// percentileIndex computes the nearest-rank index into a sorted slice of
+// length n for percentile p (0-100).
+func percentileIndex(n int, p float64) int {
+	idx := int(math.Ceil(p/100*float64(n))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= n {
+		idx = n - 1
+	}
+	return idx
+}
+
+// resultRecord is the machine-readable shape of one TestResult attempt,
+// used by writeResults for --output json|csv.
+type resultRecord struct {
+	TestName      string  `json:"test_name"`
+	Host          string  `json:"host"`
+	Attempt       int     `json:"attempt"`
+	Success       bool    `json:"success"`
+	DurationMs    float64 `json:"duration_ms"`
+	BytesSent     uint32  `json:"bytes_sent"`
+	ThroughputMBs float64 `json:"throughput_mb_s"`
+	Error         string  `json:"error,omitempty"`
+}
+
+func newResultRecord(r TestResult) resultRecord {
+	rec := resultRecord{
+		TestName:   r.TestName,
+		Host:       r.Host,
+		Attempt:    r.Attempt,
+		Success:    r.Success,
+		DurationMs: float64(r.Duration) / float64(time.Millisecond),
+		BytesSent:  r.BytesSent,
+	}
+	if r.Success && r.Duration > 0 {
+		rec.ThroughputMBs = float64(r.BytesSent) / r.Duration.Seconds() / 1024 / 1024
+	}
+	if r.Error != nil {
+		rec.Error = r.Error.Error()
+	}
+	return rec
+}
+
+// writeResults emits one record per attempt to w in the given format
+// ("json" or "csv"), so results can be piped into other tools or
+// long-term storage independent of the human-readable log on stderr.
+func writeResults(w io.Writer, format string, results []TestResult) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		for _, r := range results {
+			if err := enc.Encode(newResultRecord(r)); err != nil {
+				return fmt.Errorf("error encoding JSON record: %w", err)
+			}
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		header := []string{"test_name", "host", "attempt", "success", "duration_ms", "bytes_sent", "throughput_mb_s", "error"}
+		if err := cw.Write(header); err != nil {
+			return fmt.Errorf("error writing CSV header: %w", err)
+		}
+		for _, r := range results {
+			rec := newResultRecord(r)
+			row := []string{
+				rec.TestName,
+				rec.Host,
+				strconv.Itoa(rec.Attempt),
+				strconv.FormatBool(rec.Success),
+				strconv.FormatFloat(rec.DurationMs, 'f', 3, 64),
+				strconv.FormatUint(uint64(rec.BytesSent), 10),
+				strconv.FormatFloat(rec.ThroughputMBs, 'f', 3, 64),
+				rec.Error,
+			}
+			if err := cw.Write(row); err != nil {
+				return fmt.Errorf("error writing CSV row: %w", err)
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// performDownload requests data from the server in fixed-size chunks and
+// validates its hash, without ever holding the whole payload in memory at
+// once. progress, if non-nil, is invoked after every chunk is read.
+func performDownload(ctx context.Context, conn net.Conn, size, chunkSize uint32, progress transfer.ProgressFunc) (time.Duration, error) {
 	start := time.Now()
 
 	// Send download request: type + size
-	n, err := conn.Write([]byte{protocol.MessageTypeDownload})
+	n, err := conn.Write([]byte{protocol.MessageTypeDownloadV2})
 	if err != nil {
 		return 0, fmt.Errorf("error writing message type: %w", err)
 	}
@@ -323,11 +649,41 @@ func performDownload(conn net.Conn, size uint32) (time.Duration, error) {
 		return 0, fmt.Errorf("unexpected response size: expected %d, got %d", size, responseSize)
 	}
 
-	// Read data
-	data := make([]byte, responseSize)
-	_, err = io.ReadFull(reader, data)
-	if err != nil {
-		return 0, fmt.Errorf("error reading data: %w", err)
+	// Every payload byte read from the server is fed into the hasher as it
+	// arrives (the chunk length prefixes are not), so we never need the full payload in memory just to hash
+	// it. The callback reader reports cumulative progress on top of that.
+	hasher := sha256.New()
+	payload := transfer.NewReaderCallback(io.TeeReader(reader, hasher), int64(responseSize), progress)
+
+	buf := make([]byte, chunkSize)
+	var received uint32
+
+	for received < responseSize {
+		if err := ctx.Err(); err != nil {
+			return time.Since(start), fmt.Errorf("download cancelled: %w", err)
+		}
+
+		var chunkLen uint32
+		if err := binary.Read(reader, binary.BigEndian, &chunkLen); err != nil {
+			return time.Since(start), fmt.Errorf("error reading chunk length: %w", err)
+		}
+		if chunkLen == 0 || chunkLen > chunkSize || received+chunkLen > responseSize {
+			return time.Since(start), fmt.Errorf("invalid chunk length %d", chunkLen)
+		}
+
+		if _, err := io.ReadFull(payload, buf[:chunkLen]); err != nil {
+			return time.Since(start), fmt.Errorf("error reading chunk data: %w", err)
+		}
+		received += chunkLen
+	}
+
+	// Drain the terminating zero-length chunk marker.
+	var terminator uint32
+	if err := binary.Read(reader, binary.BigEndian, &terminator); err != nil {
+		return time.Since(start), fmt.Errorf("error reading end-of-stream marker: %w", err)
+	}
+	if terminator != 0 {
+		return time.Since(start), fmt.Errorf("expected end-of-stream marker, got chunk length %d", terminator)
 	}
 
 	// Read hash
@@ -340,27 +696,24 @@ func performDownload(conn net.Conn, size uint32) (time.Duration, error) {
 	duration := time.Since(start)
 
 	// Validate hash
-	calculatedHash := sha256.Sum256(data)
-	if calculatedHash != receivedHash {
+	if !bytes.Equal(hasher.Sum(nil), receivedHash[:]) {
 		return duration, fmt.Errorf("hash validation failed")
 	}
 
 	return duration, nil
 }
 
-// performUpload sends data to server for validation
-func performUpload(conn net.Conn, size uint32) (time.Duration, error) {
-	// Generate random data
-	data := make([]byte, size)
-	rand.Read(data)
-
-	// Calculate hash
-	hash := sha256.Sum256(data)
-
+// performUpload sends data to the server for validation in fixed-size
+// chunks, generating and hashing each chunk as it goes so the whole
+// payload is never buffered at once. progress, if non-nil, is invoked
+// after every chunk is written. If seed is non-nil, the payload is drawn
+// from a seeded PRNG so the same seed always produces the same bytes (and
+// hash) across runs; otherwise it is cryptographically random as before.
+func performUpload(ctx context.Context, conn net.Conn, size, chunkSize uint32, seed *int64, progress transfer.ProgressFunc) (time.Duration, error) {
 	start := time.Now()
 
-	// Send upload request: type + size + data + hash
-	n, err := conn.Write([]byte{protocol.MessageTypeUpload})
+	// Send upload request: type + size
+	n, err := conn.Write([]byte{protocol.MessageTypeUploadV2})
 	if err != nil {
 		return 0, fmt.Errorf("error writing message type: %w", err)
 	}
@@ -373,20 +726,56 @@ func performUpload(conn net.Conn, size uint32) (time.Duration, error) {
 		return 0, fmt.Errorf("error writing size: %w", err)
 	}
 
-	n, err = conn.Write(data)
-	if err != nil {
-		return 0, fmt.Errorf("error writing data: %w", err)
+	// Every chunk written to the server is mirrored into the hasher as it
+	// goes out, so we never need the full payload in memory just to hash
+	// it. The callback writer reports cumulative progress on top of that.
+	hasher := sha256.New()
+	payload := transfer.NewWriterCallback(io.MultiWriter(conn, hasher), int64(size), progress)
+
+	var fill func([]byte)
+	if seed != nil {
+		prng := mrand.New(mrand.NewSource(*seed))
+		fill = func(chunk []byte) { prng.Read(chunk) }
+	} else {
+		fill = func(chunk []byte) { rand.Read(chunk) }
 	}
-	if n != int(size) {
-		return 0, fmt.Errorf("wrote %d bytes instead of %d for data", n, size)
+
+	buf := make([]byte, chunkSize)
+	var sent uint32
+
+	for sent < size {
+		if err := ctx.Err(); err != nil {
+			return time.Since(start), fmt.Errorf("upload cancelled: %w", err)
+		}
+
+		n := chunkSize
+		if remaining := size - sent; remaining < n {
+			n = remaining
+		}
+		chunk := buf[:n]
+		fill(chunk)
+
+		if err := binary.Write(conn, binary.BigEndian, n); err != nil {
+			return time.Since(start), fmt.Errorf("error writing chunk length: %w", err)
+		}
+		if _, err := payload.Write(chunk); err != nil {
+			return time.Since(start), fmt.Errorf("error writing chunk data: %w", err)
+		}
+		sent += n
+	}
+
+	// Terminating zero-length chunk marker.
+	if err := binary.Write(conn, binary.BigEndian, uint32(0)); err != nil {
+		return time.Since(start), fmt.Errorf("error writing end-of-stream marker: %w", err)
 	}
 
-	n, err = conn.Write(hash[:])
+	hash := hasher.Sum(nil)
+	n2, err := conn.Write(hash)
 	if err != nil {
 		return 0, fmt.Errorf("error writing hash: %w", err)
 	}
-	if n != 32 {
-		return 0, fmt.Errorf("wrote %d bytes instead of 32 for hash", n)
+	if n2 != 32 {
+		return 0, fmt.Errorf("wrote %d bytes instead of 32 for hash", n2)
 	}
 
 	// Read result
@@ -0,0 +1,26 @@
+// Package protocol defines the wire protocol shared between the
+// access-checker client and server.
+package protocol
+
+// Message types exchanged between client and server.
+const (
+	MessageTypeDownload = 0x01
+	MessageTypeUpload   = 0x02
+
+	// MessageTypeDownloadV2 and MessageTypeUploadV2 frame the payload as a
+	// sequence of length-prefixed chunks terminated by a zero-length
+	// chunk, instead of one contiguous write/read. A server that only
+	// speaks V1 doesn't recognize these types and closes the connection,
+	// so an old server rejects a new client cleanly rather than
+	// misinterpreting the framing.
+	MessageTypeDownloadV2 = 0x03
+	MessageTypeUploadV2   = 0x04
+)
+
+// MaxDataSize is the largest payload size, in bytes, either side will
+// accept for a single test.
+const MaxDataSize = 1 << 30 // 1 GiB
+
+// DefaultChunkSize is the chunk size used by V2 transfers when the caller
+// doesn't override it.
+const DefaultChunkSize = 64 * 1024
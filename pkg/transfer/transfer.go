@@ -0,0 +1,65 @@
+// Package transfer provides small io.Reader/io.Writer wrappers that report
+// transfer progress as data moves through them, so callers can surface
+// live throughput without buffering an entire payload up front.
+package transfer
+
+import "io"
+
+// ProgressFunc is invoked after data has moved through a callback reader or
+// writer, reporting cumulative bytes transferred and the total expected
+// for the transfer (0 if unknown).
+type ProgressFunc func(bytesDone, bytesTotal int64)
+
+// CallbackReader wraps an io.Reader and invokes a ProgressFunc after every
+// Read, reporting cumulative bytes read so far.
+type CallbackReader struct {
+	r       io.Reader
+	total   int64
+	done    int64
+	onChunk ProgressFunc
+}
+
+// NewReaderCallback wraps r so onChunk is called with cumulative bytes
+// read after each Read. total is the expected size of the full transfer
+// and is passed through to onChunk unchanged.
+func NewReaderCallback(r io.Reader, total int64, onChunk ProgressFunc) *CallbackReader {
+	return &CallbackReader{r: r, total: total, onChunk: onChunk}
+}
+
+func (c *CallbackReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.done += int64(n)
+		if c.onChunk != nil {
+			c.onChunk(c.done, c.total)
+		}
+	}
+	return n, err
+}
+
+// CallbackWriter wraps an io.Writer and invokes a ProgressFunc after every
+// Write, reporting cumulative bytes written so far.
+type CallbackWriter struct {
+	w       io.Writer
+	total   int64
+	done    int64
+	onChunk ProgressFunc
+}
+
+// NewWriterCallback wraps w so onChunk is called with cumulative bytes
+// written after each Write. total is the expected size of the full
+// transfer and is passed through to onChunk unchanged.
+func NewWriterCallback(w io.Writer, total int64, onChunk ProgressFunc) *CallbackWriter {
+	return &CallbackWriter{w: w, total: total, onChunk: onChunk}
+}
+
+func (c *CallbackWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if n > 0 {
+		c.done += int64(n)
+		if c.onChunk != nil {
+			c.onChunk(c.done, c.total)
+		}
+	}
+	return n, err
+}